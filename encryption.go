@@ -0,0 +1,332 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const encryptedExt = ".tonwallet.enc"
+const passwordEnvVar = "TON_WALLET_SWITCHER_PASSWORD"
+
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+	nonceLen     = 24
+)
+
+// EncryptionConfig records the KDF parameters used to turn a passphrase into the
+// key that seals inactive wallet directories. It is nil until "passwd" is run.
+type EncryptionConfig struct {
+	KDF  string `json:"kdf"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+func newEncryptionConfig() (*EncryptionConfig, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &EncryptionConfig{
+		KDF:  "scrypt",
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+	}, nil
+}
+
+func deriveKey(password string, enc *EncryptionConfig) ([32]byte, error) {
+	var key [32]byte
+	if enc.KDF != "scrypt" {
+		return key, fmt.Errorf("unsupported KDF \"%s\"", enc.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return key, err
+	}
+	derived, err := scrypt.Key([]byte(password), salt, enc.N, enc.R, enc.P, scryptKeyLen)
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], derived)
+	return key, nil
+}
+
+// promptPassword resolves the encryption passphrase from a flag, the
+// TON_WALLET_SWITCHER_PASSWORD environment variable, or an echo-less prompt,
+// in that order.
+func promptPassword(flagValue string, prompt string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if password, ok := os.LookupEnv(passwordEnvVar); ok {
+		return password, nil
+	}
+	if !stdinIsTTY() {
+		return "", fmt.Errorf("a password is required; pass --password, set %s, or run interactively", passwordEnvVar)
+	}
+	fmt.Print(prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+func resolveEncryptionKey(config *Config, passwordFlag string) ([32]byte, error) {
+	var key [32]byte
+	if config.Encryption == nil {
+		return key, fmt.Errorf("encryption is not enabled; run \"passwd\" first")
+	}
+	if passwordFlag == "" {
+		passwordFlag = config.cachedPassword
+	}
+	password, err := promptPassword(passwordFlag, "Wallet switcher password: ")
+	if err != nil {
+		return key, err
+	}
+	return deriveKey(password, config.Encryption)
+}
+
+func blake2bSum(data []byte) string {
+	sum := blake2b.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func packDir(dirPath string) ([]byte, error) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name, err = filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unpackToDir(tarBytes []byte, dirPath string) error {
+	if err := os.MkdirAll(dirPath, 0770); err != nil {
+		return err
+	}
+	tarReader := tar.NewReader(bytes.NewReader(tarBytes))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dirPath, header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tarReader)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sealToFile(key [32]byte, plaintext []byte, path string) error {
+	var nonce [nonceLen]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	sealed := secretbox.Seal(nonce[:], plaintext, &nonce, &key)
+	return os.WriteFile(path, sealed, 0660)
+}
+
+func openFromFile(key [32]byte, path string) ([]byte, error) {
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceLen {
+		return nil, fmt.Errorf("\"%s\" is too short to be a sealed wallet", path)
+	}
+	var nonce [nonceLen]byte
+	copy(nonce[:], sealed[:nonceLen])
+	plaintext, ok := secretbox.Open(nil, sealed[nonceLen:], &nonce, &key)
+	if !ok {
+		return nil, fmt.Errorf("failed to decrypt \"%s\": wrong password or corrupted data", path)
+	}
+	return plaintext, nil
+}
+
+// encryptWalletFromDir tars dirPath, seals it into name+encryptedExt, records the
+// plaintext checksum on the wallet's config entry, and removes dirPath.
+func encryptWalletFromDir(config *Config, key [32]byte, name string, dirPath string) error {
+	tarBytes, err := packDir(dirPath)
+	if err != nil {
+		return err
+	}
+	if err := sealToFile(key, tarBytes, name+encryptedExt); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dirPath); err != nil {
+		return err
+	}
+	entry := config.Wallets[name]
+	entry.Checksum = blake2bSum(tarBytes)
+	config.Wallets[name] = entry
+	return nil
+}
+
+// decryptWalletToDir reverses encryptWalletFromDir, verifying the recorded
+// checksum before extracting into dirPath and removing the sealed file.
+func decryptWalletToDir(config *Config, key [32]byte, name string, dirPath string) error {
+	tarBytes, err := openFromFile(key, name+encryptedExt)
+	if err != nil {
+		return err
+	}
+	if entry, ok := config.Wallets[name]; ok && entry.Checksum != "" {
+		if blake2bSum(tarBytes) != entry.Checksum {
+			return fmt.Errorf("checksum mismatch for wallet \"%s\"; data may be corrupted or tampered with", name)
+		}
+	}
+	if err := unpackToDir(tarBytes, dirPath); err != nil {
+		return err
+	}
+	return os.Remove(name + encryptedExt)
+}
+
+// Passwd enables encryption (deriving fresh KDF parameters and sealing every
+// inactive wallet) or, if encryption is already enabled, re-encrypts every
+// inactive wallet under a newly chosen password.
+func Passwd(config *Config, passwordFlag string) error {
+	var oldKey [32]byte
+	changingPassword := config.Encryption != nil
+	if changingPassword {
+		var err error
+		oldKey, err = resolveEncryptionKey(config, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	newPassword, err := promptPassword(passwordFlag, "New wallet switcher password: ")
+	if err != nil {
+		return err
+	}
+	newEnc, err := newEncryptionConfig()
+	if err != nil {
+		return err
+	}
+	newKey, err := deriveKey(newPassword, newEnc)
+	if err != nil {
+		return err
+	}
+
+	for name := range config.Wallets {
+		if name == config.CurrentWallet {
+			continue
+		}
+		var tarBytes []byte
+		if changingPassword {
+			tarBytes, err = openFromFile(oldKey, name+encryptedExt)
+		} else {
+			tarBytes, err = packDir(name)
+		}
+		if err != nil {
+			return err
+		}
+		if err := sealToFile(newKey, tarBytes, name+encryptedExt); err != nil {
+			return err
+		}
+		if !changingPassword {
+			if err := os.RemoveAll(name); err != nil {
+				return err
+			}
+		}
+		entry := config.Wallets[name]
+		entry.Checksum = blake2bSum(tarBytes)
+		config.Wallets[name] = entry
+	}
+
+	config.Encryption = newEnc
+	// Cached so a keyring-backed MetadataStore can save it alongside the rest
+	// of the metadata, letting the desktop session unlock the switcher too.
+	config.cachedPassword = newPassword
+	return nil
+}
+
+// Lock seals the active wallet in place, leaving no plaintext "data" directory
+// behind until the next "switch" or "unlock".
+func Lock(config *Config, passwordFlag string) error {
+	if config.CurrentWallet == "" {
+		return fmt.Errorf("no active wallet to lock")
+	}
+	key, err := resolveEncryptionKey(config, passwordFlag)
+	if err != nil {
+		return err
+	}
+	return encryptWalletFromDir(config, key, config.CurrentWallet, currentWalletDirName)
+}
+
+// Unlock reverses Lock, decrypting the active wallet back into "data".
+func Unlock(config *Config, passwordFlag string) error {
+	if config.CurrentWallet == "" {
+		return fmt.Errorf("no active wallet to unlock")
+	}
+	key, err := resolveEncryptionKey(config, passwordFlag)
+	if err != nil {
+		return err
+	}
+	return decryptWalletToDir(config, key, config.CurrentWallet, currentWalletDirName)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"filippo.io/age"
+)
+
+const manifestEntryName = "MANIFEST.json"
+const exportFormatVersion = 1
+
+// ExportManifest is the first tar record of an export archive, readable
+// without touching the rest of the (encrypted) payload.
+type ExportManifest struct {
+	Version int `json:"version"`
+	Wallet  struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"wallet"`
+	Created string `json:"created"`
+}
+
+// walletPlaintextTar returns the tar of a tracked wallet's contents,
+// transparently decrypting it first if it's currently sealed.
+func walletPlaintextTar(config *Config, walletName string) ([]byte, error) {
+	if walletName == config.CurrentWallet {
+		// A locked active wallet has no "data" directory, only its sealed file.
+		if _, err := os.Stat(currentWalletDirName); err == nil || config.Encryption == nil {
+			return packDir(currentWalletDirName)
+		}
+	}
+	if config.Encryption != nil {
+		key, err := resolveEncryptionKey(config, "")
+		if err != nil {
+			return nil, err
+		}
+		return openFromFile(key, walletName+encryptedExt)
+	}
+	return packDir(walletName)
+}
+
+func buildExportTar(manifest ExportManifest, walletTar []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	err = tarWriter.WriteHeader(&tar.Header{Name: manifestEntryName, Size: int64(len(manifestBytes)), Mode: 0640})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tarWriter.Write(manifestBytes); err != nil {
+		return nil, err
+	}
+
+	if err := copyTarEntries(tarWriter, walletTar); err != nil {
+		return nil, err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// copyTarEntries re-emits every entry of srcTar (as read by a fresh
+// tar.Reader) through tarWriter, letting callers prepend or strip entries.
+func copyTarEntries(tarWriter *tar.Writer, srcTar []byte) error {
+	tarReader := tar.NewReader(bytes.NewReader(srcTar))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tarWriter, tarReader); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func ageEncrypt(plaintext []byte, password string) ([]byte, error) {
+	recipient, err := age.NewScryptRecipient(password)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func ageDecrypt(ciphertext []byte, password string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(password)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(ciphertext), identity)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// Export packs walletName into a single age-encrypted archive at outPath,
+// with an unencrypted-until-you-decrypt-the-payload MANIFEST.json naming it.
+func Export(config *Config, walletName string, outPath string, passwordFlag string) error {
+	entry, ok := config.Wallets[walletName]
+	if !ok {
+		return fmt.Errorf("no wallet \"%s\" present", walletName)
+	}
+
+	walletTar, err := walletPlaintextTar(config, walletName)
+	if err != nil {
+		return err
+	}
+
+	var manifest ExportManifest
+	manifest.Version = exportFormatVersion
+	manifest.Wallet.Name = walletName
+	manifest.Wallet.Description = entry.Description
+	manifest.Created = time.Now().UTC().Format(time.RFC3339)
+
+	exportTar, err := buildExportTar(manifest, walletTar)
+	if err != nil {
+		return err
+	}
+
+	password, err := promptPassword(passwordFlag, "Export password: ")
+	if err != nil {
+		return err
+	}
+
+	sealed, err := ageEncrypt(exportTar, password)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(outPath, sealed, 0640)
+}
+
+// readExportArchive decrypts an export archive and splits it back into its
+// manifest and the wallet's own tar (with MANIFEST.json stripped off).
+func readExportArchive(sealed []byte, passwordFlag string) (ExportManifest, []byte, error) {
+	var manifest ExportManifest
+
+	password, err := promptPassword(passwordFlag, "Import password: ")
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	exportTar, err := ageDecrypt(sealed, password)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	tarReader := tar.NewReader(bytes.NewReader(exportTar))
+	header, err := tarReader.Next()
+	if err != nil {
+		return manifest, nil, err
+	}
+	if header.Name != manifestEntryName {
+		return manifest, nil, fmt.Errorf("not a valid wallet export: first entry is \"%s\", not \"%s\"", header.Name, manifestEntryName)
+	}
+	manifestBytes, err := ioutil.ReadAll(tarReader)
+	if err != nil {
+		return manifest, nil, err
+	}
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return manifest, nil, err
+	}
+
+	var walletTarBuf bytes.Buffer
+	walletTarWriter := tar.NewWriter(&walletTarBuf)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, err
+		}
+		if err := walletTarWriter.WriteHeader(header); err != nil {
+			return manifest, nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(walletTarWriter, tarReader); err != nil {
+				return manifest, nil, err
+			}
+		}
+	}
+	if err := walletTarWriter.Close(); err != nil {
+		return manifest, nil, err
+	}
+
+	return manifest, walletTarBuf.Bytes(), nil
+}
+
+// Import extracts an export archive into WalletsDir and tracks it in
+// config.Wallets, without switching to it (mirroring Add's safe behavior).
+func Import(config *Config, inPath string, renameTo string, passwordFlag string) error {
+	sealed, err := ioutil.ReadFile(inPath)
+	if err != nil {
+		return err
+	}
+
+	manifest, walletTar, err := readExportArchive(sealed, passwordFlag)
+	if err != nil {
+		return err
+	}
+	if manifest.Version != exportFormatVersion {
+		return fmt.Errorf("unsupported export version %d", manifest.Version)
+	}
+
+	name := manifest.Wallet.Name
+	if renameTo != "" {
+		name = renameTo
+	}
+	if name == currentWalletDirName {
+		return fmt.Errorf("wallet name can't be \"%s\"", currentWalletDirName)
+	}
+	if _, exists := config.Wallets[name]; exists {
+		return fmt.Errorf("wallet \"%s\" already exists; use --rename to import under a different name", name)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		return fmt.Errorf("\"%s\" already exists in %s", name, config.WalletsDir)
+	}
+	if _, err := os.Stat(name + encryptedExt); !os.IsNotExist(err) {
+		return fmt.Errorf("\"%s\" already exists in %s", name+encryptedExt, config.WalletsDir)
+	}
+
+	if err := unpackToDir(walletTar, name); err != nil {
+		return err
+	}
+	config.Wallets[name] = WalletEntry{Description: manifest.Wallet.Description}
+
+	if config.Encryption != nil {
+		// The wallet was just unpacked as a plain directory; seal it like
+		// every other inactive wallet so encryption at rest actually holds.
+		key, err := resolveEncryptionKey(config, "")
+		if err != nil {
+			return err
+		}
+		if err := encryptWalletFromDir(config, key, name, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
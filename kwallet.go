@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/godbus/dbus"
+)
+
+// KWalletStore is the KWallet fallback for desktops without a Secret Service
+// provider, storing the same JSON payload as SecretServiceStore as a single
+// password entry in the user's default wallet.
+type KWalletStore struct {
+	conn   *dbus.Conn
+	handle int32
+}
+
+const (
+	kwalletDest   = "org.kde.kwalletd5"
+	kwalletPath   = dbus.ObjectPath("/modules/kwalletd5")
+	kwalletFolder = "ton-wallet-switcher"
+	kwalletEntry  = "metadata"
+	kwalletApp    = "ton-wallet-switcher"
+)
+
+func NewKWalletStore() (*KWalletStore, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to session bus: %w", err)
+	}
+
+	obj := conn.Object(kwalletDest, kwalletPath)
+
+	var walletName string
+	if err := obj.Call("org.kde.KWallet.networkWallet", 0).Store(&walletName); err != nil {
+		return nil, fmt.Errorf("kwallet unavailable: %w", err)
+	}
+
+	var handle int32
+	if err := obj.Call("org.kde.KWallet.open", 0, walletName, int64(0), kwalletApp).Store(&handle); err != nil {
+		return nil, err
+	}
+
+	return &KWalletStore{conn: conn, handle: handle}, nil
+}
+
+func (s *KWalletStore) object() dbus.BusObject {
+	return s.conn.Object(kwalletDest, kwalletPath)
+}
+
+func (s *KWalletStore) Load(config *Config) error {
+	var hasEntry bool
+	err := s.object().Call("org.kde.KWallet.hasEntry", 0, s.handle, kwalletFolder, kwalletEntry, kwalletApp).Store(&hasEntry)
+	if err != nil {
+		return err
+	}
+	if !hasEntry {
+		return nil
+	}
+
+	var raw string
+	err = s.object().Call("org.kde.KWallet.readPassword", 0, s.handle, kwalletFolder, kwalletEntry, kwalletApp).Store(&raw)
+	if err != nil {
+		return err
+	}
+
+	var stored storedMetadata
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return err
+	}
+	applyStoredMetadata(config, stored)
+	return nil
+}
+
+func (s *KWalletStore) Save(config *Config) error {
+	payload, err := json.Marshal(configToStoredMetadata(config))
+	if err != nil {
+		return err
+	}
+	var result int32
+	return s.object().Call("org.kde.KWallet.writePassword", 0, s.handle, kwalletFolder, kwalletEntry, string(payload), kwalletApp).Store(&result)
+}
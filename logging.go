@@ -21,9 +21,3 @@ func logFatal(v ...interface{}) {
 	logError(v...)
 	os.Exit(1)
 }
-
-func logHelp(v ...interface{}) {
-	logError(v...)
-	Help()
-	os.Exit(1)
-}
@@ -11,34 +11,55 @@ import (
 	"strings"
 
 	"github.com/adrg/xdg"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 const walletsDirName = "TON Wallet"
 const currentWalletDirName = "data"
 const configFilePath = "ton-wallet-switcher/ton-wallet-switcher.json"
 
-const helpMessage = `Usage: %s [COMMAND] [WALLET]
+type Config struct {
+	configFilePath string
+	WalletsDir     string `json:"wallet-directory"`
+	// Backend selects which MetadataStore holds CurrentWallet, Wallets and
+	// Encryption below; it is itself always kept in this file regardless of
+	// backend, since something has to say where to look for the rest.
+	Backend string `json:"backend,omitempty"`
+
+	CurrentWallet string                 `json:"-"`
+	Wallets       map[string]WalletEntry `json:"-"`
+	Encryption    *EncryptionConfig      `json:"-"`
+
+	// cachedPassword is filled in by a MetadataStore that can hold the
+	// encryption passphrase itself (the desktop keyring backends), so that
+	// unlocking the desktop session also unlocks the switcher.
+	cachedPassword string
+}
 
-An utility for managing multiple TON Wallet wallets
+// WalletEntry holds everything the config tracks about one wallet besides its name.
+type WalletEntry struct {
+	Description string `json:"description"`
+	// Checksum is the BLAKE2b digest of the wallet's plaintext tar, recorded once
+	// encryption is enabled so tampering with the encrypted blob is caught early.
+	Checksum string `json:"checksum,omitempty"`
+	// Fingerprint is the BLAKE2b digest of the wallet directory's "salt" file
+	// plus its mtime, recorded by "rescan" to detect directories that changed
+	// on disk since the config was last written.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
 
-Commands:
-  init            Initialize: find all wallets and ask user to describe them
-  status          List wallets
-  switch [WALLET] Switch to another wallet
-  edit [WALLET]   Edit wallet name and description
-  add [WALLET]    Add an existing wallet directory or create a new one
-  forget [WALLET] Forget about wallet
-  remove [WALLET] Forget about wallet and remove its directory
-  config          Get this utility config path
-  directory       Get %s directory path
-  help            Print this help
-`
+// WalletSeed describes a single wallet entry in a --wallet-config file, letting
+// `init` be driven declaratively instead of prompting for every wallet it finds.
+type WalletSeed struct {
+	Dir         string `yaml:"dir" json:"dir"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+}
 
-type Config struct {
-	configFilePath string
-	WalletsDir     string            `json:"wallet-directory"`
-	CurrentWallet  string            `json:"current-wallet"`
-	Wallets        map[string]string `json:"wallets"`
+type WalletSeedFile struct {
+	Wallets []WalletSeed `yaml:"wallets" json:"wallets"`
 }
 
 func getConfigFilePath() string {
@@ -82,6 +103,39 @@ func writeConfig(config *Config) error {
 	return nil
 }
 
+func readWalletSeedFile(path string) (*WalletSeedFile, error) {
+	rawSeedFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var seedFile WalletSeedFile
+	// Valid JSON is valid YAML, so a single unmarshal call accepts either.
+	err = yaml.Unmarshal(rawSeedFile, &seedFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &seedFile, nil
+}
+
+func stdinIsTTY() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// promptLine asks the user for a value when a flag wasn't given and stdin is a
+// TTY. It returns an error when the flag is missing and there is no one to ask.
+func promptLine(flagValue string, flagName string, prompt string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if !stdinIsTTY() {
+		return "", fmt.Errorf("--%s is required when stdin is not a TTY", flagName)
+	}
+	fmt.Print(prompt)
+	return scanLine(), nil
+}
+
 func getWalletsDir() string {
 	walletsDir, err := xdg.SearchDataFile(walletsDirName)
 	if err != nil {
@@ -122,24 +176,33 @@ func getWallets(walletsDir string) ([]string, error) {
 	return wallets, nil
 }
 
-func addWallet(config *Config, walletDirName string, changeCurrentWallet bool) error {
+// addWallet records walletDirName under config.Wallets, naming and describing it
+// from nameFlag/descriptionFlag when given, and falling back to an interactive
+// prompt only when the corresponding flag is empty and stdin is a TTY. A name is
+// only prompted for the "data" directory; any other directory keeps its own name.
+func addWallet(config *Config, walletDirName string, changeCurrentWallet bool, nameFlag string, descriptionFlag string) error {
 	walletName := walletDirName
 
-	if walletName == currentWalletDirName {
-		for {
-			if walletDirName == currentWalletDirName {
+	if nameFlag != "" {
+		if nameFlag == currentWalletDirName {
+			return fmt.Errorf("wallet name can't be \"%s\"", currentWalletDirName)
+		}
+		walletName = nameFlag
+	} else if walletDirName == currentWalletDirName {
+		if stdinIsTTY() {
+			for {
 				fmt.Printf("Name the \"%s\" wallet (name can't be the current one): ", walletDirName)
-			} else {
-				fmt.Printf("Name the \"%s\" wallet (name can't be \"%s\"; leave empty to keep the current one): ", walletDirName, currentWalletDirName)
-			}
-			walletName = scanLine()
-			if walletName == "" {
-				walletName = walletDirName
-			}
-			if walletName != currentWalletDirName {
-				break
+				walletName = scanLine()
+				if walletName == "" {
+					walletName = walletDirName
+				}
+				if walletName != currentWalletDirName {
+					break
+				}
+				logError("wallet name invalid")
 			}
-			logError("wallet name invalid")
+		} else {
+			return fmt.Errorf("--name is required for wallet \"%s\" when stdin is not a TTY", walletDirName)
 		}
 	}
 
@@ -147,8 +210,11 @@ func addWallet(config *Config, walletDirName string, changeCurrentWallet bool) e
 		config.CurrentWallet = walletName
 	}
 
-	fmt.Printf("Enter description for the \"%s\" wallet: ", walletName)
-	config.Wallets[walletName] = scanLine()
+	description, err := promptLine(descriptionFlag, "description", fmt.Sprintf("Enter description for the \"%s\" wallet: ", walletName))
+	if err != nil {
+		return err
+	}
+	config.Wallets[walletName] = WalletEntry{Description: description}
 	return nil
 }
 
@@ -169,7 +235,7 @@ func switchToFirstWallet(config *Config) error {
 	return nil
 }
 
-func Init(config *Config) error {
+func Init(config *Config, seedFile *WalletSeedFile) error {
 	wallets, err := getWallets(config.WalletsDir)
 	if err != nil {
 		return err
@@ -177,10 +243,18 @@ func Init(config *Config) error {
 
 	logInfo(getCount(len(wallets)), " located")
 
-	config.Wallets = make(map[string]string)
+	seeds := make(map[string]WalletSeed)
+	if seedFile != nil {
+		for _, seed := range seedFile.Wallets {
+			seeds[seed.Dir] = seed
+		}
+	}
+
+	config.Wallets = make(map[string]WalletEntry)
 	config.CurrentWallet = ""
 	for _, walletDirName := range wallets {
-		err := addWallet(config, walletDirName, true)
+		seed := seeds[walletDirName]
+		err := addWallet(config, walletDirName, true, seed.Name, seed.Description)
 		if err != nil {
 			return err
 		}
@@ -204,6 +278,35 @@ func Switch(config *Config, walletName string) error {
 	if !ok {
 		return fmt.Errorf("no wallet \"%s\" present", walletName)
 	}
+
+	if config.Encryption != nil {
+		key, err := resolveEncryptionKey(config, "")
+		if err != nil {
+			return err
+		}
+		if config.CurrentWallet != "" {
+			// data/ may already be gone if the user ran "lock" before switching;
+			// that's not an error, there's just nothing left to seal.
+			err := encryptWalletFromDir(config, key, config.CurrentWallet, currentWalletDirName)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		err = decryptWalletToDir(config, key, walletName, currentWalletDirName)
+		if err != nil && errors.Is(err, os.ErrNotExist) {
+			// No walletName+encryptedExt yet: the wallet was added but never
+			// sealed (e.g. just created by Add), so it's still a plaintext
+			// directory of its own name. Move it into place like the
+			// unencrypted path does instead of silently doing nothing.
+			err = os.Rename(walletName, currentWalletDirName)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		config.CurrentWallet = walletName
+		return nil
+	}
+
 	if config.CurrentWallet != "" {
 		err := os.Rename(currentWalletDirName, config.CurrentWallet)
 		if err != nil {
@@ -218,39 +321,60 @@ func Switch(config *Config, walletName string) error {
 	return nil
 }
 
-func Edit(config *Config, walletName string) error {
+func Edit(config *Config, walletName string, nameFlag string, descriptionFlag string) error {
 	_, ok := config.Wallets[walletName]
 	if !ok {
 		return fmt.Errorf("no wallet \"%s\" present", walletName)
 	}
-	var newWalletName string
-	for {
-		fmt.Printf("Enter new name for the \"%s\" wallet (can't be \"%s\"; leave empty to keep the name): ", walletName, currentWalletDirName)
-		newWalletName = scanLine()
-		if newWalletName == "" {
+
+	newWalletName := nameFlag
+	if newWalletName == "" {
+		if stdinIsTTY() {
+			for {
+				fmt.Printf("Enter new name for the \"%s\" wallet (can't be \"%s\"; leave empty to keep the name): ", walletName, currentWalletDirName)
+				newWalletName = scanLine()
+				if newWalletName == "" {
+					newWalletName = walletName
+				}
+				if newWalletName != currentWalletDirName {
+					break
+				}
+				logError("wallet name invalid")
+			}
+		} else {
 			newWalletName = walletName
 		}
-		if newWalletName != currentWalletDirName {
-			break
-		}
-		logError("wallet name invalid")
+	} else if newWalletName == currentWalletDirName {
+		return fmt.Errorf("wallet name can't be \"%s\"", currentWalletDirName)
 	}
 
-	fmt.Printf("Enter description for the \"%s\" (\"%s\") wallet (leave empty to keep the description): ", walletName, newWalletName)
-	newWalletDescription := scanLine()
+	entry := config.Wallets[walletName]
+
+	newWalletDescription := descriptionFlag
 	if newWalletDescription == "" {
-		newWalletDescription = config.Wallets[walletName]
+		if stdinIsTTY() {
+			fmt.Printf("Enter description for the \"%s\" (\"%s\") wallet (leave empty to keep the description): ", walletName, newWalletName)
+			newWalletDescription = scanLine()
+		}
+		if newWalletDescription == "" {
+			newWalletDescription = entry.Description
+		}
 	}
 
 	if config.CurrentWallet == walletName {
 		config.CurrentWallet = newWalletName
 	} else if newWalletName != walletName {
-		err := os.Rename(walletName, newWalletName)
+		oldPath, newPath := walletName, newWalletName
+		if config.Encryption != nil {
+			oldPath, newPath = walletName+encryptedExt, newWalletName+encryptedExt
+		}
+		err := os.Rename(oldPath, newPath)
 		if err != nil {
 			return err
 		}
 	}
-	config.Wallets[newWalletName] = newWalletDescription
+	entry.Description = newWalletDescription
+	config.Wallets[newWalletName] = entry
 	if walletName != newWalletName {
 		delete(config.Wallets, walletName)
 	}
@@ -261,7 +385,7 @@ func getRelativeWalletDirectory(walletDirName string) string {
 	return filepath.Join(walletsDirName, walletDirName)
 }
 
-func Add(config *Config, walletDirName string) error {
+func Add(config *Config, walletDirName string, nameFlag string, descriptionFlag string) error {
 	walletDirInfo, err := os.Stat(walletDirName)
 	exists := !errors.Is(err, os.ErrNotExist)
 	if exists {
@@ -272,7 +396,7 @@ func Add(config *Config, walletDirName string) error {
 			return fmt.Errorf("\"%s\" is not a wallet directory", getRelativeWalletDirectory(walletDirName))
 		}
 	}
-	err = addWallet(config, walletDirName, false)
+	err = addWallet(config, walletDirName, false, nameFlag, descriptionFlag)
 	if err != nil {
 		return err
 	}
@@ -287,7 +411,17 @@ func Forget(config *Config, walletName string) error {
 		return fmt.Errorf("no wallet \"%s\" present", walletName)
 	}
 	if config.CurrentWallet == walletName {
-		err := os.Rename(currentWalletDirName, walletName)
+		var err error
+		if config.Encryption != nil {
+			var key [32]byte
+			key, err = resolveEncryptionKey(config, "")
+			if err != nil {
+				return err
+			}
+			err = encryptWalletFromDir(config, key, walletName, currentWalletDirName)
+		} else {
+			err = os.Rename(currentWalletDirName, walletName)
+		}
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
@@ -303,30 +437,43 @@ func Forget(config *Config, walletName string) error {
 	return nil
 }
 
-func Remove(config *Config, walletName string) error {
+func Remove(config *Config, walletName string, yes bool) error {
 	_, ok := config.Wallets[walletName]
 	if !ok {
 		return fmt.Errorf("no wallet \"%s\" present", walletName)
 	}
-	fmt.Printf("Do you really want to remove the \"%s\" wallet? Type \"yes\" to confirm: ", walletName)
-	confirmation := scanLine()
-	if confirmation == "yes" {
-		err := Forget(config, walletName)
-		if err != nil {
-			return err
+	if !yes {
+		if !stdinIsTTY() {
+			return fmt.Errorf("refusing to remove wallet \"%s\" without --yes when stdin is not a TTY", walletName)
 		}
-		err = os.RemoveAll(walletName)
+		fmt.Printf("Do you really want to remove the \"%s\" wallet? Type \"yes\" to confirm: ", walletName)
+		if scanLine() != "yes" {
+			return fmt.Errorf("operation aborted")
+		}
+	}
+	err := Forget(config, walletName)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(walletName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if config.Encryption != nil {
+		// Forget seals the wallet into walletName+encryptedExt rather than a
+		// plain directory once encryption is on; remove that too.
+		err = os.RemoveAll(walletName + encryptedExt)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
-		return nil
 	}
-	return fmt.Errorf("operation aborted")
+	return nil
 }
 
 func Status(config *Config) {
 	fmt.Println(getCount(len(config.Wallets)) + ":")
-	for name, description := range config.Wallets {
+	for name, entry := range config.Wallets {
+		description := entry.Description
 		if name == config.CurrentWallet {
 			description += " (current)"
 		}
@@ -334,86 +481,381 @@ func Status(config *Config) {
 	}
 }
 
-func Help() {
-	fmt.Printf(helpMessage, os.Args[0], walletsDirName)
+// activeStore is resolved once per run, from Config.Backend, by loadConfig or
+// the init action, which can't rely on loadConfig.
+var activeStore MetadataStore
+
+// loadConfig reads the config file, resolving WalletsDir and chdir'ing into it,
+// then loads wallet metadata through the configured MetadataStore. When no
+// config file is present yet it runs Init so that scripted, flag-driven
+// invocations don't need a separate manual `init` step.
+func loadConfig(config *Config, seedFile *WalletSeedFile) {
+	var err error
+	*config, err = getConfig()
+	if config.WalletsDir == "" {
+		config.WalletsDir = getWalletsDir()
+	}
+	if err2 := os.Chdir(config.WalletsDir); err2 != nil {
+		logFatal(err2)
+	}
+
+	var storeErr error
+	activeStore, storeErr = newMetadataStore(config.Backend)
+	if storeErr != nil {
+		logFatal(storeErr)
+	}
+
+	if err != nil {
+		logError(err)
+		logInfo("failed to read config file, performing initialization")
+		mustWriteConfig(config, Init(config, seedFile))
+		os.Exit(0)
+	}
+
+	if err := activeStore.Load(config); err != nil {
+		logFatal(err)
+	}
+}
+
+func mustWriteConfig(config *Config, err error) {
+	if err != nil {
+		logFatal(err)
+	}
+	if err := writeConfig(config); err != nil {
+		logFatal(err)
+	}
+	if err := activeStore.Save(config); err != nil {
+		logFatal(err)
+	}
 }
 
 func main() {
 	var config Config
-	var err error
 
-	wrapSubcommand := func(err error) {
-		if err != nil {
-			logFatal(err)
+	app := &cli.App{
+		Name:                 filepath.Base(os.Args[0]),
+		Usage:                fmt.Sprintf("An utility for managing multiple %s wallets", walletsDirName),
+		UsageText:            fmt.Sprintf("%s [COMMAND] [WALLET]", filepath.Base(os.Args[0])),
+		EnableBashCompletion: true,
+		Commands: []*cli.Command{
+			{
+				Name:      "init",
+				Usage:     "Find all wallets and ask user to describe them",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "wallet-config", Usage: "path to a YAML/JSON file seeding `{name, description}` for each wallet directory"},
+					&cli.StringFlag{Name: "backend", Value: backendFile, Usage: "metadata backend: file, secret-service or kwallet"},
+				},
+				Action: func(c *cli.Context) error {
+					var seedFile *WalletSeedFile
+					if path := c.String("wallet-config"); path != "" {
+						var err error
+						seedFile, err = readWalletSeedFile(path)
+						if err != nil {
+							return err
+						}
+					}
+					config.configFilePath = getConfigFilePath()
+					config.WalletsDir = getWalletsDir()
+					config.Backend = c.String("backend")
+					var err error
+					activeStore, err = newMetadataStore(config.Backend)
+					if err != nil {
+						return err
+					}
+					mustWriteConfig(&config, Init(&config, seedFile))
+					return nil
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "List wallets",
+				Action: func(c *cli.Context) error {
+					loadConfig(&config, nil)
+					Status(&config)
+					return nil
+				},
+			},
+			{
+				Name:      "switch",
+				Usage:     "Switch to another wallet",
+				ArgsUsage: "WALLET",
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Switch(&config, c.Args().First()))
+					return nil
+				},
+			},
+			{
+				Name:      "edit",
+				Usage:     "Edit wallet name and description",
+				ArgsUsage: "WALLET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "name", Usage: "new wallet name"},
+					&cli.StringFlag{Name: "description", Usage: "new wallet description"},
+				},
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Edit(&config, c.Args().First(), c.String("name"), c.String("description")))
+					return nil
+				},
+			},
+			{
+				Name:      "add",
+				Usage:     "Add an existing wallet directory or create a new one",
+				ArgsUsage: "WALLET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "name", Usage: "wallet name"},
+					&cli.StringFlag{Name: "description", Usage: "wallet description"},
+				},
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Add(&config, c.Args().First(), c.String("name"), c.String("description")))
+					return nil
+				},
+			},
+			{
+				Name:      "forget",
+				Usage:     "Forget about wallet",
+				ArgsUsage: "WALLET",
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Forget(&config, c.Args().First()))
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Forget about wallet and remove its directory",
+				ArgsUsage: "WALLET",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "yes", Usage: "skip the confirmation prompt"},
+				},
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Remove(&config, c.Args().First(), c.Bool("yes")))
+					return nil
+				},
+			},
+			{
+				Name:  "rescan",
+				Usage: "Reconcile WalletsDir with the config without wiping it",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "adopt", Usage: "track new wallet directories found on disk"},
+					&cli.BoolFlag{Name: "prune", Usage: "forget wallets whose directory has disappeared"},
+					&cli.BoolFlag{Name: "dry-run", Usage: "only print what would change"},
+				},
+				Action: func(c *cli.Context) error {
+					loadConfig(&config, nil)
+					report, err := Rescan(&config, c.Bool("adopt"), c.Bool("prune"), c.Bool("dry-run"))
+					if err != nil {
+						return err
+					}
+					printRescanReport(report)
+					if c.Bool("dry-run") {
+						return nil
+					}
+					mustWriteConfig(&config, nil)
+					return nil
+				},
+			},
+			{
+				Name:  "passwd",
+				Usage: "Enable wallet encryption, or change the password of an already-encrypted config",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "password", Usage: "new password (falls back to " + passwordEnvVar + ", then a prompt)"},
+				},
+				Action: func(c *cli.Context) error {
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Passwd(&config, c.String("password")))
+					return nil
+				},
+			},
+			{
+				Name:  "lock",
+				Usage: "Encrypt the active wallet's \"data\" directory in place",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "password", Usage: "password (falls back to " + passwordEnvVar + ", then a prompt)"},
+				},
+				Action: func(c *cli.Context) error {
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Lock(&config, c.String("password")))
+					return nil
+				},
+			},
+			{
+				Name:  "unlock",
+				Usage: "Decrypt the active wallet back into \"data\"",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "password", Usage: "password (falls back to " + passwordEnvVar + ", then a prompt)"},
+				},
+				Action: func(c *cli.Context) error {
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Unlock(&config, c.String("password")))
+					return nil
+				},
+			},
+			{
+				Name:      "migrate",
+				Usage:     "Copy wallet metadata to a different backend",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "to", Required: true, Usage: "destination backend: file, secret-service or kwallet"},
+				},
+				Action: func(c *cli.Context) error {
+					loadConfig(&config, nil)
+					toBackend := c.String("to")
+					to, err := newMetadataStore(toBackend)
+					if err != nil {
+						return err
+					}
+					// Set the backend before saving: FileMetadataStore.Save records
+					// config.Backend into the same file as the metadata, and the other
+					// stores need it reflected in WalletsDir's skeleton file below.
+					config.Backend = toBackend
+					if err := to.Save(&config); err != nil {
+						return err
+					}
+					if toBackend == backendFile {
+						// to.Save already wrote WalletsDir, Backend and the metadata
+						// together; writeConfig here would overwrite it with a bare
+						// skeleton, since Config's metadata fields are json:"-".
+						return nil
+					}
+					return writeConfig(&config)
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "Export a wallet as a single encrypted archive",
+				ArgsUsage: "WALLET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "out", Required: true, Usage: "output .tws archive path"},
+					&cli.StringFlag{Name: "password", Usage: "export password (falls back to " + passwordEnvVar + ", then a prompt)"},
+				},
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					outPath, err := filepath.Abs(c.String("out"))
+					if err != nil {
+						return err
+					}
+					loadConfig(&config, nil)
+					return Export(&config, c.Args().First(), outPath, c.String("password"))
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import a wallet from an archive produced by \"export\"",
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "rename", Usage: "import under a different wallet name"},
+					&cli.StringFlag{Name: "password", Usage: "import password (falls back to " + passwordEnvVar + ", then a prompt)"},
+				},
+				Action: func(c *cli.Context) error {
+					if !c.Args().Present() {
+						return fmt.Errorf("no argument")
+					}
+					inPath, err := filepath.Abs(c.Args().First())
+					if err != nil {
+						return err
+					}
+					loadConfig(&config, nil)
+					mustWriteConfig(&config, Import(&config, inPath, c.String("rename"), c.String("password")))
+					return nil
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Get this utility config path",
+				Action: func(c *cli.Context) error {
+					fmt.Println(getConfigFilePath())
+					return nil
+				},
+			},
+			{
+				Name:  "directory",
+				Usage: fmt.Sprintf("Get %s directory path", walletsDirName),
+				Action: func(c *cli.Context) error {
+					fmt.Println(getWalletsDir())
+					return nil
+				},
+			},
+		},
+	}
+
+	err := app.Run(reorderArgsForFlags(app.Commands, os.Args))
+	if err != nil {
+		logFatal(err)
+	}
+}
+
+// reorderArgsForFlags moves every flag (and, for non-boolean flags, the value
+// following it) ahead of positional arguments for the invoked subcommand.
+// urfave/cli, like the stdlib flag package it's built on, stops parsing flags
+// at the first positional argument, so "edit alice --name bob" would
+// otherwise silently ignore --name; this lets flags come in any order.
+func reorderArgsForFlags(commands []*cli.Command, args []string) []string {
+	if len(args) < 3 {
+		return args
+	}
+
+	var command *cli.Command
+	for _, candidate := range commands {
+		if candidate.Name == args[1] {
+			command = candidate
+			break
 		}
-		err = writeConfig(&config)
-		if err != nil {
-			logFatal(err)
+	}
+	if command == nil {
+		return args
+	}
+
+	boolFlags := make(map[string]bool)
+	for _, flag := range command.Flags {
+		if _, ok := flag.(*cli.BoolFlag); !ok {
+			continue
+		}
+		for _, name := range flag.Names() {
+			boolFlags["-"+name] = true
+			boolFlags["--"+name] = true
 		}
 	}
 
-	loadConfig := func() {
-		config, err = getConfig()
-		if config.WalletsDir == "" {
-			config.WalletsDir = getWalletsDir()
+	rest := args[2:]
+	var flagArgs, positionalArgs []string
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positionalArgs = append(positionalArgs, arg)
+			continue
 		}
-		err2 := os.Chdir(config.WalletsDir)
-		if err2 != nil {
-			logFatal(err2)
+		flagArgs = append(flagArgs, arg)
+		if strings.Contains(arg, "=") || boolFlags[arg] {
+			continue
 		}
-		if err != nil {
-			logError(err)
-			logInfo("failed to read config file, performing initialization")
-			wrapSubcommand(Init(&config))
-			os.Exit(0)
-		}
-	}
-
-	if len(os.Args) > 1 {
-		subcommand := os.Args[1]
-		if len(os.Args) > 2 {
-			argument := strings.Join(os.Args[2:], " ")
-			switch subcommand {
-			case "switch":
-				loadConfig()
-				wrapSubcommand(Switch(&config, argument))
-			case "edit":
-				loadConfig()
-				wrapSubcommand(Edit(&config, argument))
-			case "add":
-				loadConfig()
-				wrapSubcommand(Add(&config, argument))
-			case "forget":
-				loadConfig()
-				wrapSubcommand(Forget(&config, argument))
-			case "remove":
-				loadConfig()
-				wrapSubcommand(Remove(&config, argument))
-			default:
-				logHelp("unknown subcommand")
-			}
-		} else {
-			switch subcommand {
-			case "init":
-				config.configFilePath = getConfigFilePath()
-				config.WalletsDir = getWalletsDir()
-				wrapSubcommand(Init(&config))
-			case "status":
-				loadConfig()
-				Status(&config)
-			case "config":
-				fmt.Println(getConfigFilePath())
-			case "directory":
-				fmt.Println(getWalletsDir())
-			case "help":
-				Help()
-			case "switch", "edit", "add", "forget", "remove":
-				logHelp("no argument")
-			default:
-				logHelp("unknown subcommand")
-			}
+		if i+1 < len(rest) && !strings.HasPrefix(rest[i+1], "-") {
+			i++
+			flagArgs = append(flagArgs, rest[i])
 		}
-	} else {
-		logHelp("no subcommand specified")
 	}
+
+	reordered := append([]string{args[0], args[1]}, flagArgs...)
+	return append(reordered, positionalArgs...)
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+)
+
+const (
+	backendFile          = "file"
+	backendSecretService = "secret-service"
+	backendKWallet       = "kwallet"
+)
+
+// MetadataStore persists the parts of Config that describe the wallets
+// themselves - the current-wallet pointer, per-wallet descriptions/checksums,
+// and the encryption parameters - independently of where WalletsDir and the
+// backend choice are recorded (always the plain config file, see Config.Backend).
+type MetadataStore interface {
+	Load(config *Config) error
+	Save(config *Config) error
+}
+
+func newMetadataStore(backend string) (MetadataStore, error) {
+	switch backend {
+	case "", backendFile:
+		return FileMetadataStore{}, nil
+	case backendSecretService:
+		return NewSecretServiceStore()
+	case backendKWallet:
+		return NewKWalletStore()
+	default:
+		return nil, fmt.Errorf("unknown metadata backend \"%s\"", backend)
+	}
+}
+
+// storedMetadata is the payload every backend persists, serialized as JSON
+// regardless of whether it ends up on disk or inside a keyring secret.
+type storedMetadata struct {
+	CurrentWallet string                 `json:"current-wallet"`
+	Wallets       map[string]WalletEntry `json:"wallets"`
+	Encryption    *EncryptionConfig      `json:"encryption,omitempty"`
+	// Password is only ever populated by keyring-backed stores: writing it to
+	// the plain config file would defeat the point of "encryption at rest".
+	Password string `json:"password,omitempty"`
+}
+
+func configToStoredMetadata(config *Config) storedMetadata {
+	return storedMetadata{
+		CurrentWallet: config.CurrentWallet,
+		Wallets:       config.Wallets,
+		Encryption:    config.Encryption,
+		Password:      config.cachedPassword,
+	}
+}
+
+func applyStoredMetadata(config *Config, stored storedMetadata) {
+	config.CurrentWallet = stored.CurrentWallet
+	config.Wallets = stored.Wallets
+	config.Encryption = stored.Encryption
+	config.cachedPassword = stored.Password
+}
+
+// FileMetadataStore keeps wallet metadata in the same JSON file as
+// WalletsDir and Backend, which is how every earlier version of this tool
+// behaved. It never persists cachedPassword.
+type FileMetadataStore struct{}
+
+func (FileMetadataStore) Load(config *Config) error {
+	raw, err := ioutil.ReadFile(config.configFilePath)
+	if err != nil {
+		return err
+	}
+	var stored storedMetadata
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return err
+	}
+	stored.Password = ""
+	applyStoredMetadata(config, stored)
+	return nil
+}
+
+func (FileMetadataStore) Save(config *Config) error {
+	combined := struct {
+		WalletsDir string `json:"wallet-directory"`
+		Backend    string `json:"backend,omitempty"`
+		storedMetadata
+	}{config.WalletsDir, config.Backend, configToStoredMetadata(config)}
+	combined.Password = ""
+
+	encoded, err := json.MarshalIndent(combined, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.configFilePath, encoded, fs.FileMode(0660))
+}
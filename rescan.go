@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// RescanReport is what Rescan found when comparing WalletsDir against config.
+type RescanReport struct {
+	New     []string // wallet directories on disk that aren't tracked in the config
+	Missing []string // tracked wallets whose directory has disappeared
+	Changed []string // tracked wallets whose directory fingerprint no longer matches
+	// MismatchedCurrent, if non-empty, is the name of a tracked wallet whose
+	// fingerprint matches the active "data" directory even though it isn't
+	// config.CurrentWallet - i.e. the user swapped "data" externally.
+	MismatchedCurrent string
+}
+
+func fingerprintWalletDir(walletsDir string, dirName string) (string, error) {
+	saltPath := filepath.Join(walletsDir, dirName, "salt")
+	salt, err := ioutil.ReadFile(saltPath)
+	if err != nil {
+		return "", err
+	}
+	saltInfo, err := os.Stat(saltPath)
+	if err != nil {
+		return "", err
+	}
+	sum := blake2b.Sum256(append(salt, []byte(saltInfo.ModTime().String())...))
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// Rescan walks WalletsDir and reconciles it against config.Wallets, without the
+// destructive wipe-and-reprompt that Init does. adopt tracks new directories it
+// finds (and fixes config.CurrentWallet if "data" turns out to match a known,
+// non-current wallet); prune drops tracked wallets whose directory is gone.
+// With dryRun, config is left untouched and only the report is returned.
+func Rescan(config *Config, adopt bool, prune bool, dryRun bool) (RescanReport, error) {
+	var report RescanReport
+
+	if config.Encryption != nil {
+		return report, fmt.Errorf("rescan does not support encrypted wallets yet")
+	}
+
+	dirs, err := getWallets(config.WalletsDir)
+	if err != nil {
+		return report, err
+	}
+
+	onDisk := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		name := dir
+		if dir == currentWalletDirName {
+			name = config.CurrentWallet
+		}
+		onDisk[name] = true
+
+		fingerprint, err := fingerprintWalletDir(config.WalletsDir, dir)
+		if err != nil {
+			return report, err
+		}
+
+		entry, tracked := config.Wallets[name]
+		if !tracked {
+			report.New = append(report.New, dir)
+			if !adopt || dryRun {
+				continue
+			}
+			if err := addWallet(config, dir, dir == currentWalletDirName, "", ""); err != nil {
+				return report, err
+			}
+			name = dir
+			if dir == currentWalletDirName {
+				name = config.CurrentWallet
+			}
+			entry = config.Wallets[name]
+		}
+
+		if entry.Fingerprint != "" && entry.Fingerprint != fingerprint {
+			report.Changed = append(report.Changed, name)
+		}
+		if !dryRun {
+			entry.Fingerprint = fingerprint
+			config.Wallets[name] = entry
+		}
+	}
+
+	for name := range config.Wallets {
+		if onDisk[name] {
+			continue
+		}
+		report.Missing = append(report.Missing, name)
+		if prune && !dryRun {
+			delete(config.Wallets, name)
+		}
+	}
+
+	if config.CurrentWallet != "" {
+		if dataFingerprint, err := fingerprintWalletDir(config.WalletsDir, currentWalletDirName); err == nil {
+			for name, entry := range config.Wallets {
+				if name != config.CurrentWallet && entry.Fingerprint != "" && entry.Fingerprint == dataFingerprint {
+					report.MismatchedCurrent = name
+					if adopt && !dryRun {
+						config.CurrentWallet = name
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func printRescanReport(report RescanReport) {
+	for _, dir := range report.New {
+		logInfo(fmt.Sprintf("new wallet directory found: \"%s\"", dir))
+	}
+	for _, name := range report.Missing {
+		logInfo(fmt.Sprintf("configured wallet \"%s\" has no directory on disk", name))
+	}
+	for _, name := range report.Changed {
+		logInfo(fmt.Sprintf("wallet \"%s\" directory contents changed since it was last scanned", name))
+	}
+	if report.MismatchedCurrent != "" {
+		logInfo(fmt.Sprintf("\"%s\" directory now matches wallet \"%s\", not the configured current wallet", currentWalletDirName, report.MismatchedCurrent))
+	}
+}
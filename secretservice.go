@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/godbus/dbus"
+)
+
+// SecretServiceStore keeps wallet metadata as a single secret item in the
+// user's freedesktop.org Secret Service keyring (GNOME Keyring, KeePassXC's
+// secret service, etc.), so unlocking the desktop session unlocks the switcher.
+type SecretServiceStore struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+const (
+	ssDest         = "org.freedesktop.secrets"
+	ssPath         = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssDefaultAlias = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	ssAppAttribute = "ton-wallet-switcher"
+)
+
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func NewSecretServiceStore() (*SecretServiceStore, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to session bus: %w", err)
+	}
+
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = conn.Object(ssDest, ssPath).
+		Call("org.freedesktop.Secret.Service.OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		return nil, fmt.Errorf("secret service unavailable (is a keyring daemon running?): %w", err)
+	}
+
+	return &SecretServiceStore{conn: conn, session: session}, nil
+}
+
+func (s *SecretServiceStore) findItem() (item dbus.ObjectPath, unlocked bool, err error) {
+	attributes := map[string]string{"application": ssAppAttribute}
+	var unlockedItems, lockedItems []dbus.ObjectPath
+	err = s.conn.Object(ssDest, ssPath).
+		Call("org.freedesktop.Secret.Service.SearchItems", 0, attributes).
+		Store(&unlockedItems, &lockedItems)
+	if err != nil {
+		return "", false, err
+	}
+	if len(unlockedItems) > 0 {
+		return unlockedItems[0], true, nil
+	}
+	if len(lockedItems) > 0 {
+		return lockedItems[0], false, nil
+	}
+	return "", false, nil
+}
+
+func (s *SecretServiceStore) Load(config *Config) error {
+	item, unlocked, err := s.findItem()
+	if err != nil {
+		return err
+	}
+	if item == "" {
+		return nil
+	}
+	if !unlocked {
+		return fmt.Errorf("the \"%s\" keyring item is locked; unlock your desktop keyring and retry", ssAppAttribute)
+	}
+
+	var secret ssSecret
+	err = s.conn.Object(ssDest, item).
+		Call("org.freedesktop.Secret.Item.GetSecret", 0, s.session).
+		Store(&secret)
+	if err != nil {
+		return err
+	}
+
+	var stored storedMetadata
+	if err := json.Unmarshal(secret.Value, &stored); err != nil {
+		return err
+	}
+	applyStoredMetadata(config, stored)
+	return nil
+}
+
+func (s *SecretServiceStore) Save(config *Config) error {
+	payload, err := json.Marshal(configToStoredMetadata(config))
+	if err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(ssAppAttribute),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(map[string]string{"application": ssAppAttribute}),
+	}
+	secret := ssSecret{Session: s.session, Parameters: []byte{}, Value: payload, ContentType: "application/json"}
+
+	var item, prompt dbus.ObjectPath
+	err = s.conn.Object(ssDest, ssDefaultAlias).
+		Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, secret, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	if prompt == dbus.ObjectPath("/") {
+		return nil
+	}
+	return s.runPrompt(prompt)
+}
+
+// runPrompt drives a Secret Service prompt object to completion: some
+// daemons require this on the very first write to a collection (e.g. to
+// unlock it or confirm the new item), and CreateItem only starts it -
+// without this, Save can report success while nothing was persisted.
+func (s *SecretServiceStore) runPrompt(prompt dbus.ObjectPath) error {
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	matchRule := fmt.Sprintf("type='signal',interface='org.freedesktop.Secret.Prompt',member='Completed',path='%s'", prompt)
+	if err := s.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, matchRule).Err; err != nil {
+		return err
+	}
+	defer s.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, matchRule)
+
+	if err := s.conn.Object(ssDest, prompt).Call("org.freedesktop.Secret.Prompt.Prompt", 0, "").Err; err != nil {
+		return err
+	}
+
+	for sig := range signals {
+		if sig.Path != prompt || sig.Name != "org.freedesktop.Secret.Prompt.Completed" {
+			continue
+		}
+		if dismissed, ok := sig.Body[0].(bool); ok && dismissed {
+			return fmt.Errorf("keyring prompt was dismissed")
+		}
+		return nil
+	}
+	return fmt.Errorf("keyring prompt closed without completing")
+}